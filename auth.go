@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	pushAudience       = config.String("push_audience")
+	pushServiceAccount = config.String("push_service_account")
+	pushToken          = config.String("push_token") // shared-secret fallback via ?token=
+)
+
+const googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIDTokenClaims is the subset of a Google-signed OIDC ID token
+// that Pub/Sub push authentication relies on.
+type googleIDTokenClaims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// verifyPushRequest authenticates an incoming Pub/Sub push request,
+// either via the shared `?token=` query parameter or via the OIDC
+// `Authorization: Bearer <JWT>` header Pub/Sub attaches when the push
+// subscription has authentication enabled. It returns an error for
+// any request that can't be verified.
+func verifyPushRequest(ctx context.Context, r *http.Request) error {
+	if pushToken != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(pushToken)) == 1 {
+		return nil
+	}
+
+	authz := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(authz, prefix) {
+		return fmt.Errorf("missing bearer token")
+	}
+	tokenString := strings.TrimPrefix(authz, prefix)
+
+	var claims googleIDTokenClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("missing kid")
+		}
+		return googleCerts.get(ctx, kid)
+	})
+	if err != nil {
+		return fmt.Errorf("verify id token: %w", err)
+	}
+
+	if claims.Issuer != "https://accounts.google.com" && claims.Issuer != "accounts.google.com" {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if pushAudience == "" || !audienceContains(claims.Audience, pushAudience) {
+		return fmt.Errorf("unexpected audience")
+	}
+	if !claims.EmailVerified || claims.Email != pushServiceAccount {
+		return fmt.Errorf("unexpected service account %q", claims.Email)
+	}
+
+	return nil
+}
+
+func audienceContains(aud jwt.ClaimStrings, want string) bool {
+	for _, a := range aud {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+var googleCerts = newJWKSCache(googleCertsURL)
+
+// jwkSet is a JSON Web Key Set as served by Google's certs endpoint.
+type jwkSet struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// jwksCache fetches and caches Google's RS256 public keys, keyed by
+// kid, refetching once the cache has expired.
+type jwksCache struct {
+	url string
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expiresAt time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{url: url}
+}
+
+func (c *jwksCache) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Now().Before(c.expiresAt) {
+		if key, ok := c.keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	keys, expiresAt, err := fetchJWKS(ctx, c.url)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.expiresAt = expiresAt
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]*rsa.PublicKey, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("fetch jwks: unexpected status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var set jwkSet
+	err = json.Unmarshal(body, &set)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := jwkToRSAPublicKey(k.N, k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	return keys, time.Now().Add(jwksCacheTTL(resp.Header.Get("Cache-Control"))), nil
+}
+
+// jwksCacheTTL parses the max-age directive Google's certs endpoint
+// sends, falling back to a conservative default if it's missing.
+func jwksCacheTTL(cacheControl string) time.Duration {
+	const fallback = time.Hour
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		var seconds int
+		_, err := fmt.Sscanf(directive, "max-age=%d", &seconds)
+		if err != nil || seconds <= 0 {
+			return fallback
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+func jwkToRSAPublicKey(nStr, eStr string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(nStr)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(eStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWKSCacheTTL(t *testing.T) {
+	cases := []struct {
+		name         string
+		cacheControl string
+		want         time.Duration
+	}{
+		{"typical google header", "public, max-age=21600, must-revalidate, no-transform", 21600 * time.Second},
+		{"max-age only", "max-age=60", 60 * time.Second},
+		{"missing max-age falls back", "public, must-revalidate", time.Hour},
+		{"empty header falls back", "", time.Hour},
+		{"zero max-age falls back", "max-age=0", time.Hour},
+		{"garbage max-age falls back", "max-age=soon", time.Hour},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := jwksCacheTTL(c.cacheControl); got != c.want {
+				t.Errorf("jwksCacheTTL(%q) = %v, want %v", c.cacheControl, got, c.want)
+			}
+		})
+	}
+}
+
+// TestVerifyPushRequestOIDCToken signs a JWT with a freshly generated
+// RSA key, serves its public key from a fake JWKS endpoint, and checks
+// that verifyPushRequest accepts a well-formed Google-style ID token
+// and rejects one with the wrong audience or service account.
+func TestVerifyPushRequestOIDCToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	const kid = "test-kid"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes())
+		fmt.Fprintf(w, `{"keys":[{"kid":%q,"kty":"RSA","n":%q,"e":%q}]}`, kid, n, e)
+	}))
+	defer srv.Close()
+
+	origCerts, origAudience, origAccount := googleCerts, pushAudience, pushServiceAccount
+	googleCerts = newJWKSCache(srv.URL)
+	pushAudience = "https://push.example.com"
+	pushServiceAccount = "pusher@example.iam.gserviceaccount.com"
+	defer func() {
+		googleCerts, pushAudience, pushServiceAccount = origCerts, origAudience, origAccount
+	}()
+
+	sign := func(aud, email string, verified bool) string {
+		claims := googleIDTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:   "https://accounts.google.com",
+				Audience: jwt.ClaimStrings{aud},
+			},
+			Email:         email,
+			EmailVerified: verified,
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return s
+	}
+
+	newReq := func(tokenString string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tokenString != "" {
+			r.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		return r
+	}
+
+	t.Run("valid token is accepted", func(t *testing.T) {
+		r := newReq(sign(pushAudience, pushServiceAccount, true))
+		if err := verifyPushRequest(r.Context(), r); err != nil {
+			t.Errorf("verifyPushRequest() = %v, want nil", err)
+		}
+	})
+
+	t.Run("wrong audience is rejected", func(t *testing.T) {
+		r := newReq(sign("https://someone-else.example.com", pushServiceAccount, true))
+		if err := verifyPushRequest(r.Context(), r); err == nil {
+			t.Errorf("verifyPushRequest() = nil, want error for wrong audience")
+		}
+	})
+
+	t.Run("wrong service account is rejected", func(t *testing.T) {
+		r := newReq(sign(pushAudience, "someone-else@example.iam.gserviceaccount.com", true))
+		if err := verifyPushRequest(r.Context(), r); err == nil {
+			t.Errorf("verifyPushRequest() = nil, want error for wrong service account")
+		}
+	})
+
+	t.Run("unverified email is rejected", func(t *testing.T) {
+		r := newReq(sign(pushAudience, pushServiceAccount, false))
+		if err := verifyPushRequest(r.Context(), r); err == nil {
+			t.Errorf("verifyPushRequest() = nil, want error for unverified email")
+		}
+	})
+
+	t.Run("missing bearer token is rejected", func(t *testing.T) {
+		r := newReq("")
+		if err := verifyPushRequest(r.Context(), r); err == nil {
+			t.Errorf("verifyPushRequest() = nil, want error for missing token")
+		}
+	})
+}
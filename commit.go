@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commitInfo is the metadata resolved for a single commit.
+type commitInfo struct {
+	SHA     string
+	Subject string
+	Body    string
+	Author  string
+	Email   string
+	Time    time.Time
+	Files   []string // paths changed by this commit
+}
+
+// gitilesHost is the Cloud Source Repositories gitiles-compatible
+// endpoint used to resolve commit metadata.
+var gitilesHost = config.StringDefault("gitiles_host", "https://source.developers.google.com")
+
+var commitCacheSize = func() int {
+	n, err := strconv.Atoi(config.StringDefault("commit_cache_size", "256"))
+	if err != nil || n <= 0 {
+		return 256
+	}
+	return n
+}()
+
+var commits = newCommitCache(commitCacheSize)
+
+// commitCache is a small LRU cache of resolved commits, keyed by
+// "projectID/repoName@sha", so retried deliveries for the same push
+// don't re-fetch metadata that's already been resolved.
+type commitCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type commitCacheEntry struct {
+	key   string
+	value commitInfo
+}
+
+func newCommitCache(capacity int) *commitCache {
+	return &commitCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *commitCache) get(key string) (commitInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return commitInfo{}, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*commitCacheEntry).value, true
+}
+
+func (c *commitCache) add(key string, v commitInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*commitCacheEntry).value = v
+		return
+	}
+
+	el := c.ll.PushFront(&commitCacheEntry{key: key, value: v})
+	c.items[key] = el
+
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*commitCacheEntry).key)
+	}
+}
+
+// resolveCommit fetches (and caches) the metadata for a single commit
+// via the gitiles-compatible Cloud Source Repositories REST API.
+func resolveCommit(ctx context.Context, projectID, repoName, sha string) (commitInfo, error) {
+	key := fmt.Sprintf("%s/%s@%s", projectID, repoName, sha)
+	if ci, ok := commits.get(key); ok {
+		return ci, nil
+	}
+
+	url := fmt.Sprintf("%s/p/%s/r/%s/+/%s?format=JSON", gitilesHost, projectID, repoName, sha)
+	ci, err := fetchGitilesCommit(ctx, url, sha)
+	if err != nil {
+		return commitInfo{}, err
+	}
+
+	commits.add(key, ci)
+	return ci, nil
+}
+
+// resolveCommitRange resolves every commit reachable from includeSHA
+// but not excludeSHA, in the same order gitiles returns them: newest
+// first. Callers computing commits dropped by a force-push pass
+// ev.NewID as excludeSHA and ev.OldID as includeSHA, i.e. commits that
+// were reachable before the push and no longer are.
+func resolveCommitRange(ctx context.Context, projectID, repoName, excludeSHA, includeSHA string) ([]commitInfo, error) {
+	if includeSHA == "" || strings.Trim(includeSHA, "0") == "" {
+		return nil, nil
+	}
+
+	rangeSpec := includeSHA
+	if excludeSHA != "" && strings.Trim(excludeSHA, "0") != "" {
+		rangeSpec = excludeSHA + ".." + includeSHA
+	}
+
+	url := fmt.Sprintf("%s/p/%s/r/%s/+log/%s?format=JSON", gitilesHost, projectID, repoName, rangeSpec)
+	shas, err := fetchGitilesLog(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	commitList := make([]commitInfo, 0, len(shas))
+	for _, sha := range shas {
+		ci, err := resolveCommit(ctx, projectID, repoName, sha)
+		if err != nil {
+			return nil, err
+		}
+		commitList = append(commitList, ci)
+	}
+	return commitList, nil
+}
+
+// gitilesLogResponse is the relevant subset of a gitiles `+log` JSON
+// response. The body is prefixed with a ")]}'" XSSI guard that must
+// be stripped before decoding.
+type gitilesLogResponse struct {
+	Log []struct {
+		Commit string `json:"commit"`
+	} `json:"log"`
+}
+
+// gitilesCommitResponse is the relevant subset of a gitiles commit
+// detail JSON response.
+type gitilesCommitResponse struct {
+	Commit   string       `json:"commit"`
+	Author   gitilesIdent `json:"author"`
+	Message  string       `json:"message"`
+	TreeDiff []struct {
+		NewPath string `json:"new_path"`
+		OldPath string `json:"old_path"`
+	} `json:"tree_diff"`
+}
+
+type gitilesIdent struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Time  string `json:"time"`
+}
+
+// gitilesTimeLayout is the format gitiles uses for author/committer
+// timestamps, e.g. "Tue Jan 01 00:00:00 2019 +0000" — Go's git-style
+// layout, not RFC1123Z.
+const gitilesTimeLayout = "Mon Jan 02 15:04:05 2006 -0700"
+
+func fetchGitilesLog(ctx context.Context, url string) ([]string, error) {
+	var resp gitilesLogResponse
+	err := getGitilesJSON(ctx, url, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	shas := make([]string, 0, len(resp.Log))
+	for _, c := range resp.Log {
+		shas = append(shas, c.Commit)
+	}
+	return shas, nil
+}
+
+func fetchGitilesCommit(ctx context.Context, url, sha string) (commitInfo, error) {
+	var resp gitilesCommitResponse
+	err := getGitilesJSON(ctx, url, &resp)
+	if err != nil {
+		return commitInfo{}, err
+	}
+
+	subject, body := splitCommitMessage(resp.Message)
+
+	files := make([]string, 0, len(resp.TreeDiff))
+	for _, td := range resp.TreeDiff {
+		path := td.NewPath
+		if path == "" {
+			path = td.OldPath
+		}
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+
+	commitTime, err := time.Parse(gitilesTimeLayout, resp.Author.Time)
+	if err != nil {
+		return commitInfo{}, fmt.Errorf("parse commit time %q: %w", resp.Author.Time, err)
+	}
+
+	return commitInfo{
+		SHA:     sha,
+		Subject: subject,
+		Body:    body,
+		Author:  resp.Author.Name,
+		Email:   resp.Author.Email,
+		Time:    commitTime,
+		Files:   files,
+	}, nil
+}
+
+func splitCommitMessage(msg string) (subject, body string) {
+	msg = strings.TrimRight(msg, "\n")
+	parts := strings.SplitN(msg, "\n\n", 2)
+	subject = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		body = strings.TrimSpace(parts[1])
+	}
+	return subject, body
+}
+
+// gitilesJSONPrefix is Gitiles' XSSI protection prefix, present on
+// every JSON response.
+const gitilesJSONPrefix = ")]}'\n"
+
+func getGitilesJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("gitiles: GET %s: unexpected status %s", url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimPrefix(body, []byte(gitilesJSONPrefix))
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResolveCommitRangeExcludeIncludeOrder pins the exclude/include
+// argument order: resolveCommitRange must build a gitiles range spec
+// of "excludeSHA..includeSHA", not the reverse, so callers computing
+// dropped commits on a force-push (exclude=ev.NewID, include=ev.OldID)
+// get commits reachable from the old ref but no longer from the new one.
+func TestResolveCommitRangeExcludeIncludeOrder(t *testing.T) {
+	var gotPath string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/+log/") {
+			gotPath = r.URL.Path + "?" + r.URL.RawQuery
+		}
+		switch {
+		case r.URL.Path == "/p/proj/r/repo/+log/new..old":
+			fmt.Fprint(w, `)]}'`+"\n"+`{"log":[{"commit":"aaa"}]}`)
+		case r.URL.Path == "/p/proj/r/repo/+/aaa":
+			fmt.Fprint(w, `)]}'`+"\n"+`{"commit":"aaa","author":{"name":"A","email":"a@example.com","time":"Tue Jan 01 00:00:00 2019 +0000"},"message":"subject"}`)
+		default:
+			t.Errorf("unexpected request path %q", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	origHost := gitilesHost
+	gitilesHost = srv.URL
+	defer func() { gitilesHost = origHost }()
+
+	commits = newCommitCache(commitCacheSize)
+
+	got, err := resolveCommitRange(context.Background(), "proj", "repo", "new", "old")
+	if err != nil {
+		t.Fatalf("resolveCommitRange: %v", err)
+	}
+
+	if len(got) != 1 || got[0].SHA != "aaa" {
+		t.Fatalf("resolveCommitRange returned %+v, want [{SHA: aaa}]", got)
+	}
+	if want := "/p/proj/r/repo/+log/new..old?format=JSON"; gotPath != want {
+		t.Fatalf("range spec built wrong URL: got %q, want %q", gotPath, want)
+	}
+}
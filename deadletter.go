@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+var (
+	deadLetterFile  = config.String("dead_letter_file")
+	deadLetterTopic = config.String("dead_letter_topic")
+)
+
+var deadLetterTopicHandle = struct {
+	once  sync.Once
+	topic *pubsub.Topic
+	err   error
+}{}
+
+// deadLetterRecord is what gets logged/written/published when a push
+// event has permanently failed delivery after exhausting retries.
+type deadLetterRecord struct {
+	Data  *data  `json:"data"`
+	Error string `json:"error"`
+}
+
+// deadLetter records a permanently failed delivery: it always logs,
+// and additionally appends to dead_letter_file and/or publishes to
+// dead_letter_topic when those are configured.
+func deadLetter(ctx context.Context, d *data, cause error) {
+	log.Printf("permanent delivery failure for %s: %v", d.Name, cause)
+
+	rec := deadLetterRecord{Data: d, Error: cause.Error()}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		log.Println("dead letter: marshal record:", err)
+		return
+	}
+
+	if deadLetterFile != "" {
+		if err := appendDeadLetterFile(body); err != nil {
+			log.Println("dead letter: write file:", err)
+		}
+	}
+
+	if deadLetterTopic != "" {
+		if err := publishDeadLetter(ctx, body); err != nil {
+			log.Println("dead letter: publish topic:", err)
+		}
+	}
+}
+
+func appendDeadLetterFile(body []byte) error {
+	f, err := os.OpenFile(deadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	body = append(body, '\n')
+	_, err = f.Write(body)
+	return err
+}
+
+func publishDeadLetter(ctx context.Context, body []byte) error {
+	topic, err := getDeadLetterTopic(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := topic.Publish(ctx, &pubsub.Message{Data: body})
+	_, err = result.Get(ctx)
+	return err
+}
+
+func getDeadLetterTopic(ctx context.Context) (*pubsub.Topic, error) {
+	deadLetterTopicHandle.once.Do(func() {
+		c, err := pubsub.NewClient(ctx, config.String("project_id"))
+		if err != nil {
+			deadLetterTopicHandle.err = err
+			return
+		}
+		deadLetterTopicHandle.topic = c.Topic(deadLetterTopic)
+	})
+	return deadLetterTopicHandle.topic, deadLetterTopicHandle.err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+var (
+	smtpAddr     = config.String("smtp_addr") // host:port
+	smtpUsername = config.String("smtp_username")
+	smtpPassword = config.String("smtp_password")
+	smtpFrom     = config.String("smtp_from")
+	smtpTo       = config.String("smtp_to") // comma-separated
+)
+
+type emailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func newEmailNotifier() Notifier {
+	if smtpAddr == "" || smtpFrom == "" || smtpTo == "" {
+		return nil
+	}
+
+	var to []string
+	for _, addr := range strings.Split(smtpTo, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if smtpUsername != "" {
+		host := smtpAddr
+		if i := strings.IndexByte(host, ':'); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", smtpUsername, smtpPassword, host)
+	}
+
+	return &emailNotifier{
+		addr: smtpAddr,
+		auth: auth,
+		from: smtpFrom,
+		to:   to,
+	}
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, d *data, ev *updateEvent) error {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if !ok {
+		return nil
+	}
+
+	subject := fmt.Sprintf("[%s] %s: %s", repoName, ev.RefName, ev.UpdateType)
+	body := fmt.Sprintf(
+		"Repository: %s\r\nBranch: %s\r\nUpdate type: %s\r\nCommit: %s\r\n",
+		d.Name, ev.RefName, ev.UpdateType, commitURL(projectID, repoName, ev.NewID),
+	)
+
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "\r\n%s", body)
+
+	return smtp.SendMail(n.addr, n.auth, n.from, n.to, msg.Bytes())
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v28/github"
+	"golang.org/x/oauth2"
+)
+
+var (
+	githubToken = config.String("github_token")
+	githubOwner = config.String("github_owner")
+	githubRepo  = config.String("github_repo")
+)
+
+type githubNotifier struct {
+	client *github.Client
+	owner  string
+	repo   string
+}
+
+func newGitHubNotifier() Notifier {
+	if githubToken == "" || githubOwner == "" || githubRepo == "" {
+		return nil
+	}
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
+	httpClient := oauth2.NewClient(context.Background(), ts)
+
+	return &githubNotifier{
+		client: github.NewClient(httpClient),
+		owner:  githubOwner,
+		repo:   githubRepo,
+	}
+}
+
+func (n *githubNotifier) Notify(ctx context.Context, d *data, ev *updateEvent) error {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if !ok {
+		return nil
+	}
+
+	title := fmt.Sprintf("[%s] %s updated", repoName, ev.RefName)
+	body := fmt.Sprintf(
+		"Repository: %s\nBranch: %s\nUpdate type: %s\nCommit: %s\n",
+		d.Name, ev.RefName, ev.UpdateType, commitURL(projectID, repoName, ev.NewID),
+	)
+
+	_, _, err := n.client.Issues.Create(ctx, n.owner, n.repo, &github.IssueRequest{
+		Title: &title,
+		Body:  &body,
+	})
+	return err
+}
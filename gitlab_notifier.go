@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	gitlabURL     = config.StringDefault("gitlab_url", "https://gitlab.com")
+	gitlabToken   = config.String("gitlab_token")
+	gitlabProject = config.String("gitlab_project") // numeric ID or URL-encoded path
+)
+
+type gitlabNotifier struct {
+	apiURL  string
+	token   string
+	project string
+}
+
+func newGitLabNotifier() Notifier {
+	if gitlabToken == "" || gitlabProject == "" {
+		return nil
+	}
+	return &gitlabNotifier{
+		apiURL:  gitlabURL,
+		token:   gitlabToken,
+		project: gitlabProject,
+	}
+}
+
+func (n *gitlabNotifier) Notify(ctx context.Context, d *data, ev *updateEvent) error {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if !ok {
+		return nil
+	}
+
+	title := fmt.Sprintf("[%s] %s updated", repoName, ev.RefName)
+	description := fmt.Sprintf(
+		"Repository: %s\nBranch: %s\nUpdate type: %s\nCommit: %s\n",
+		d.Name, ev.RefName, ev.UpdateType, commitURL(projectID, repoName, ev.NewID),
+	)
+
+	buf := bytes.Buffer{}
+	err := json.NewEncoder(&buf).Encode(map[string]string{
+		"title":       title,
+		"description": description,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v4/projects/%s/issues", n.apiURL, n.project)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", n.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("gitlab: create issue: unexpected status %s", resp.Status)
+	}
+	return nil
+}
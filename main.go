@@ -1,14 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"mime"
 	"net/http"
@@ -21,12 +16,19 @@ import (
 )
 
 var (
-	config   = configfile.NewReader("config")
-	mode     = config.String("mode") // push, pull
-	slackURL = config.String("slack_url")
+	config = configfile.NewReader("config")
+	mode   = config.String("mode") // push, pull
 )
 
+var client = http.Client{
+	Timeout: 5 * time.Second,
+}
+
+var notifiers []Notifier
+
 func main() {
+	notifiers = newNotifiers()
+
 	if mode == "push" {
 		port := config.StringDefault("port", "8080")
 		startPush(port)
@@ -51,21 +53,26 @@ func startPull() {
 	fmt.Printf("subscribe to %s/%s\n", projectID, subscription)
 	err = client.SubscriptionInProject(subscription, projectID).
 		Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-			defer msg.Ack()
-
 			fmt.Println("received message")
 
 			var d data
 			err := json.Unmarshal(msg.Data, &d)
 			if err != nil {
+				log.Println("invalid message body:", err)
+				msg.Ack() // malformed message, redelivery won't help
 				return
 			}
 
-			err = processData(&d)
+			err = processDataWithRetry(ctx, &d)
 			if err != nil {
-				msg.Nack()
+				deadLetter(ctx, &d, err)
+				// Already recorded to the dead-letter sink: ack so
+				// Pub/Sub doesn't redeliver and re-dead-letter it.
+				msg.Ack()
 				return
 			}
+
+			msg.Ack()
 		})
 	if err != nil {
 		log.Fatal(err)
@@ -76,13 +83,21 @@ func startPull() {
 func startPush(port string) {
 	fmt.Println("Listening on", port)
 	http.ListenAndServe(":"+port, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-
 		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := verifyPushRequest(r.Context(), r)
+		if err != nil {
+			log.Println("reject push request:", err)
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+
 		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
 		if mt != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
@@ -93,14 +108,16 @@ func startPush(port string) {
 			} `json:"message"`
 			Subscription string `json:"subscription"`
 		}
-		err := json.NewDecoder(r.Body).Decode(&msg)
+		err = json.NewDecoder(r.Body).Decode(&msg)
 		if err != nil {
 			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
 		if msg.Subscription == "" {
 			log.Println("invalid message")
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
@@ -109,84 +126,74 @@ func startPush(port string) {
 		var d data
 		err = json.Unmarshal(msg.Message.Data, &d)
 		if err != nil {
-			log.Println("invalid message body")
+			log.Println("invalid message body:", err)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		processData(&d)
+		err = processDataWithRetry(r.Context(), &d)
+		if err != nil {
+			deadLetter(r.Context(), &d, err)
+			// Already recorded to the dead-letter sink: acknowledge so
+			// Pub/Sub doesn't redeliver and re-dead-letter it.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	}))
 }
 
-func processData(d *data) error {
-	for _, ev := range d.RefUpdateEvent.RefUpdates {
-		err := processUpdateEvent(d, &ev)
-		if err != nil {
-			return err
+// eventsToNotify returns the ref updates from d worth notifying about,
+// i.e. those with a recognized update type.
+func eventsToNotify(d *data) []*updateEvent {
+	var evs []*updateEvent
+	for k := range d.RefUpdateEvent.RefUpdates {
+		ev := d.RefUpdateEvent.RefUpdates[k]
+		if updateTypeColor[ev.UpdateType] == "" {
+			continue
 		}
+		evs = append(evs, &ev)
 	}
-	return nil
+	return evs
+}
+
+// batchNotifier is implemented by notifiers that want to see every
+// ref update from a single push event at once, e.g. to group them
+// under one Slack thread. Notifiers that only care about individual
+// updates can implement just Notifier.
+type batchNotifier interface {
+	NotifyBatch(ctx context.Context, d *data, evs []*updateEvent) error
 }
 
-func processUpdateEvent(d *data, ev *updateEvent) error {
-	color := updateTypeColor[ev.UpdateType]
-	if color == "" {
-		return nil
+func notifyEvents(ctx context.Context, n Notifier, d *data, evs []*updateEvent) error {
+	if bn, ok := n.(batchNotifier); ok {
+		return bn.NotifyBatch(ctx, d, evs)
 	}
 
-	var (
-		projectID string
-		repoName  string
-	)
-	{
-		xs := strings.SplitN(d.Name, "/", 4)
-		if len(xs) != 4 {
-			return nil
+	var firstErr error
+	for _, ev := range evs {
+		err := n.Notify(ctx, d, ev)
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
-		projectID = xs[1]
-		repoName = xs[3]
 	}
+	return firstErr
+}
 
-	commitURL := fmt.Sprintf("https://source.cloud.google.com/%s/%s/+/%s", projectID, repoName, ev.NewID)
-
-	// https://source.developers.google.com/p/moonrhythm-core/r/makro-accountconnect/8de10e0d546f9d86799597770a373de0a1c2ec8d
-
-	return sendSlackMessage(&slackMsg{
-		Attachments: []slackAttachment{
-			{
-				Fallback: fmt.Sprintf("%s:%s",
-					d.Name,
-					ev.RefName,
-				),
-				Color:      color,
-				Title:      "Cloud Repo",
-				TitleLink:  commitURL,
-				AuthorName: d.RefUpdateEvent.Email,
-				AuthorIcon: gravatarURL(d.RefUpdateEvent.Email),
-				Fields: []slackField{
-					{
-						Title: "Repository",
-						Value: d.Name,
-					},
-					{
-						Title: "Branch",
-						Value: ev.RefName,
-					},
-					{
-						Title: "Email",
-						Value: d.RefUpdateEvent.Email,
-					},
-					{
-						Title: "Update Type",
-						Value: ev.UpdateType,
-					},
-					{
-						Title: "Commit SHA",
-						Value: ev.NewID,
-					},
-				},
-			},
-		},
-	})
+// repoProjectAndName splits a Cloud Source Repositories resource name
+// ("projects/<project>/repos/<repo>") into its project ID and repo name.
+func repoProjectAndName(name string) (projectID, repoName string, ok bool) {
+	xs := strings.SplitN(name, "/", 4)
+	if len(xs) != 4 {
+		return "", "", false
+	}
+	return xs[1], xs[3], true
+}
+
+// commitURL builds the Cloud Source Repositories web link for a commit.
+func commitURL(projectID, repoName, sha string) string {
+	return fmt.Sprintf("https://source.cloud.google.com/%s/%s/+/%s", projectID, repoName, sha)
 }
 
 var updateTypeColor = map[string]string{
@@ -212,70 +219,3 @@ type updateEvent struct {
 	OldID      string `json:"oldId"`
 	NewID      string `json:"newId"`
 }
-
-type slackMsg struct {
-	Text        string            `json:"text,omitempty"`
-	Attachments []slackAttachment `json:"attachments,omitempty"`
-}
-
-type slackAttachment struct {
-	Fallback   string       `json:"fallback"`
-	Color      string       `json:"color"`
-	Pretext    string       `json:"pretext"`
-	AuthorName string       `json:"author_name,omitempty"`
-	AuthorLink string       `json:"author_link,omitempty"`
-	AuthorIcon string       `json:"author_icon,omitempty"`
-	Title      string       `json:"title"`
-	TitleLink  string       `json:"title_link"`
-	Text       string       `json:"text"`
-	Fields     []slackField `json:"fields"`
-	ImageURL   string       `json:"image_url,omitempty"`
-	ThumbURL   string       `json:"thumb_url,omitempty"`
-	Footer     string       `json:"footer,omitempty"`
-	FooterIcon string       `json:"footer_icon,omitempty"`
-	Timestamp  int64        `json:"ts"`
-}
-
-type slackField struct {
-	Title string `json:"title"`
-	Value string `json:"value"`
-	Short bool   `json:"short"`
-}
-
-var client = http.Client{
-	Timeout: 5 * time.Second,
-}
-
-func gravatarURL(email string) string {
-	if email == "" {
-		return ""
-	}
-	s := md5.Sum([]byte(email))
-	return "http://gravatar.com/avatar/" + hex.EncodeToString(s[:])
-}
-
-func sendSlackMessage(message *slackMsg) error {
-	if slackURL == "" {
-		return nil
-	}
-
-	buf := bytes.Buffer{}
-	err := json.NewEncoder(&buf).Encode(message)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest(http.MethodPost, slackURL, &buf)
-	if err != nil {
-		return err
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	io.Copy(ioutil.Discard, resp.Body)
-	resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("response not ok")
-	}
-	return nil
-}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// Notifier sends a notification for a single ref update event.
+type Notifier interface {
+	Notify(ctx context.Context, d *data, ev *updateEvent) error
+}
+
+// filteredNotifier wraps a Notifier so it only fires for a configured
+// set of update types. An empty set means no filtering (always fire).
+type filteredNotifier struct {
+	Notifier
+	updateTypes map[string]bool
+}
+
+func (f *filteredNotifier) Notify(ctx context.Context, d *data, ev *updateEvent) error {
+	if len(f.updateTypes) > 0 && !f.updateTypes[ev.UpdateType] {
+		return nil
+	}
+	return f.Notifier.Notify(ctx, d, ev)
+}
+
+// NotifyBatch filters evs down to the configured update types and
+// forwards them through notifyEvents, so a filtered notifier still
+// goes through the wrapped Notifier's batchNotifier behavior (e.g.
+// Slack's single-thread-per-push notifications) instead of silently
+// falling back to one call per event. Without this, filteredNotifier
+// would only satisfy the plain Notifier interface and notifyEvents'
+// type switch on batchNotifier would never see the wrapped notifier.
+func (f *filteredNotifier) NotifyBatch(ctx context.Context, d *data, evs []*updateEvent) error {
+	var filtered []*updateEvent
+	for _, ev := range evs {
+		if len(f.updateTypes) > 0 && !f.updateTypes[ev.UpdateType] {
+			continue
+		}
+		filtered = append(filtered, ev)
+	}
+	return notifyEvents(ctx, f.Notifier, d, filtered)
+}
+
+// parseUpdateTypes parses a comma-separated list of update types
+// (e.g. "UPDATE_NON_FAST_FORWARD,DELETE") into a lookup set.
+func parseUpdateTypes(s string) map[string]bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	m := make(map[string]bool)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			m[p] = true
+		}
+	}
+	return m
+}
+
+// newNotifiers builds the list of enabled notifiers from config.
+// `notifiers` is a comma-separated list of sink names; each enabled
+// sink may restrict itself to a subset of update types via
+// `notify_<sink>_types`.
+func newNotifiers() []Notifier {
+	var ns []Notifier
+
+	for _, name := range strings.Split(config.StringDefault("notifiers", "slack"), ",") {
+		name = strings.TrimSpace(name)
+
+		var n Notifier
+		switch name {
+		case "slack":
+			n = newSlackNotifier()
+		case "github":
+			n = newGitHubNotifier()
+		case "gitlab":
+			n = newGitLabNotifier()
+		case "email":
+			n = newEmailNotifier()
+		default:
+			continue
+		}
+		if n == nil {
+			continue
+		}
+
+		if types := parseUpdateTypes(config.String("notify_" + name + "_types")); types != nil {
+			n = &filteredNotifier{Notifier: n, updateTypes: types}
+		}
+		ns = append(ns, n)
+	}
+
+	return ns
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+// TestFilteredNotifierSatisfiesBatchNotifier guards against filteredNotifier
+// embedding Notifier by value and only promoting Notify: wrapping a
+// batch-capable notifier (e.g. slackNotifier) must still satisfy
+// batchNotifier, or notifyEvents silently falls back to one call per
+// event and breaks threading/grouping.
+func TestFilteredNotifierSatisfiesBatchNotifier(t *testing.T) {
+	inner := &slackNotifier{}
+	var n Notifier = &filteredNotifier{Notifier: inner, updateTypes: map[string]bool{"CREATE": true}}
+
+	if _, ok := n.(batchNotifier); !ok {
+		t.Fatalf("filteredNotifier wrapping a batchNotifier must itself satisfy batchNotifier")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+var retryMaxAttempts = func() int {
+	n, err := strconv.Atoi(config.StringDefault("retry_max_attempts", "5"))
+	if err != nil || n <= 0 {
+		return 5
+	}
+	return n
+}()
+
+var retryBaseDelay = func() time.Duration {
+	d, err := time.ParseDuration(config.StringDefault("retry_base_delay", "200ms"))
+	if err != nil || d <= 0 {
+		return 200 * time.Millisecond
+	}
+	return d
+}()
+
+var retryMaxDelay = func() time.Duration {
+	d, err := time.ParseDuration(config.StringDefault("retry_max_delay", "30s"))
+	if err != nil || d <= 0 {
+		return 30 * time.Second
+	}
+	return d
+}()
+
+// withRetry runs fn, retrying with exponential backoff and jitter, for
+// at most retryMaxAttempts attempts in all (the first one included).
+// It returns the error of the last attempt, or nil as soon as an
+// attempt succeeds. It stops early with ctx.Err() if ctx is done.
+func withRetry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= retryMaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if attempt == retryMaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoffDelay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// backoffDelay returns the delay before the given retry attempt
+// (1-indexed): a base delay that doubles each attempt up to
+// retryMaxDelay, of which a random amount between half and all of it
+// is used, so many concurrent retries don't line up.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
+
+// processDataWithRetry notifies every notifier about d, retrying each
+// notifier independently with the configured retry policy. Scoping
+// retries per notifier (rather than retrying the whole batch) means a
+// notifier that already succeeded isn't re-invoked just because a
+// different one is still failing, which would otherwise re-post
+// already-delivered notifications (e.g. a new Slack thread) on every
+// retry.
+func processDataWithRetry(ctx context.Context, d *data) error {
+	evs := eventsToNotify(d)
+	if len(evs) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	for _, n := range notifiers {
+		n := n
+		err := withRetry(ctx, func() error {
+			return notifyEvents(ctx, n, d, evs)
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// routingRule maps a (project, repo, ref, update type) pattern to a
+// Slack destination and an optional message template. Rules are
+// evaluated in file order; the first match wins. Project/repo/ref/
+// update type are glob patterns as understood by path.Match (so
+// "refs/heads/release/*" matches one ref segment, not "**"); an empty
+// pattern matches anything.
+type routingRule struct {
+	ProjectID  string `yaml:"project_id"`
+	Repo       string `yaml:"repo"`
+	Ref        string `yaml:"ref"`
+	UpdateType string `yaml:"update_type"`
+	Channel    string `yaml:"channel"`     // bot-mode Slack channel override
+	WebhookURL string `yaml:"webhook_url"` // webhook-mode destination override
+	Template   string `yaml:"template"`    // optional text/template for the message body
+}
+
+var rules = loadRules(config.String("rules_file"))
+
+func loadRules(path string) []routingRule {
+	if path == "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Println("rules: read", path, ":", err)
+		return nil
+	}
+
+	var rs []routingRule
+	// yaml.v2 parses JSON too (JSON is a subset of YAML), so this one
+	// loader covers both the YAML and JSON cases the rules file can take.
+	err = yaml.Unmarshal(body, &rs)
+	if err != nil {
+		log.Println("rules: parse", path, ":", err)
+		return nil
+	}
+	return rs
+}
+
+// matchRule returns the first rule whose patterns match, or nil if
+// no rule applies (callers fall back to their own default behavior).
+func matchRule(projectID, repoName, ref, updateType string) *routingRule {
+	for i := range rules {
+		r := &rules[i]
+		if globMatch(r.ProjectID, projectID) &&
+			globMatch(r.Repo, repoName) &&
+			globMatch(r.Ref, ref) &&
+			globMatch(r.UpdateType, updateType) {
+			return r
+		}
+	}
+	return nil
+}
+
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
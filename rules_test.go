@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"empty pattern matches anything", "", "anything", true},
+		{"exact match", "refs/heads/main", "refs/heads/main", true},
+		{"single segment wildcard matches", "refs/heads/release/*", "refs/heads/release/v1", true},
+		{"wildcard does not cross segments", "refs/heads/release/*", "refs/heads/release/v1/hotfix", false},
+		{"mismatch", "refs/heads/main", "refs/heads/dev", false},
+		{"invalid pattern does not match", "[", "[", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := globMatch(c.pattern, c.s); got != c.want {
+				t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+			}
+		})
+	}
+}
+
+// TestMatchRulePrecedence pins that rules are evaluated in file order
+// and the first match wins, even when a later rule is also a match.
+func TestMatchRulePrecedence(t *testing.T) {
+	orig := rules
+	rules = []routingRule{
+		{ProjectID: "proj", Repo: "repo", Ref: "refs/heads/release/*", UpdateType: "", Channel: "release-channel"},
+		{ProjectID: "proj", Repo: "repo", Ref: "", UpdateType: "", Channel: "catch-all-channel"},
+	}
+	defer func() { rules = orig }()
+
+	r := matchRule("proj", "repo", "refs/heads/release/v1", "CREATE")
+	if r == nil || r.Channel != "release-channel" {
+		t.Fatalf("matchRule() = %+v, want the first matching rule (release-channel)", r)
+	}
+
+	r = matchRule("proj", "repo", "refs/heads/main", "CREATE")
+	if r == nil || r.Channel != "catch-all-channel" {
+		t.Fatalf("matchRule() = %+v, want the catch-all rule when the specific rule doesn't match", r)
+	}
+
+	r = matchRule("other", "repo", "refs/heads/main", "CREATE")
+	if r != nil {
+		t.Fatalf("matchRule() = %+v, want nil when no rule's project_id matches", r)
+	}
+}
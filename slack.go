@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	slackURL     = config.String("slack_url")
+	slackToken   = config.String("slack_token")
+	slackChannel = config.String("slack_channel")
+)
+
+// slackNotifier posts notifications to Slack. With slack_token and
+// slack_channel configured it posts via chat.postMessage as a bot,
+// which allows threading: when a single push event carries multiple
+// ref updates, one parent message is posted and each ref update is
+// threaded as a reply. With only slack_url configured it falls back
+// to posting through the incoming webhook, one message per ref
+// update, since webhooks have no way to report a ts to thread on.
+type slackNotifier struct {
+	client  *slack.Client
+	channel string
+}
+
+func newSlackNotifier() Notifier {
+	if slackToken != "" && slackChannel != "" {
+		return &slackNotifier{client: slack.New(slackToken), channel: slackChannel}
+	}
+	if slackURL != "" {
+		return &slackNotifier{}
+	}
+	return nil
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, d *data, ev *updateEvent) error {
+	return n.NotifyBatch(ctx, d, []*updateEvent{ev})
+}
+
+func (n *slackNotifier) NotifyBatch(ctx context.Context, d *data, evs []*updateEvent) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	for _, group := range n.groupByDestination(d, evs) {
+		var err error
+		if n.client == nil {
+			err = n.notifyViaWebhook(ctx, d, group)
+		} else {
+			err = n.notifyViaBot(ctx, d, group)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// slackDestinationGroup is a run of ref updates that resolve to the
+// same Slack destination (channel in bot mode, webhook URL in webhook
+// mode), so they can share one thread/parent message.
+type slackDestinationGroup struct {
+	dest string
+	evs  []*updateEvent
+}
+
+// groupByDestination buckets evs by the destination their routing
+// rule (if any) resolves to, preserving first-seen order, so each
+// bucket can be posted/threaded independently.
+func (n *slackNotifier) groupByDestination(d *data, evs []*updateEvent) []slackDestinationGroup {
+	var groups []slackDestinationGroup
+	index := make(map[string]int)
+
+	for _, ev := range evs {
+		dest, _ := n.destination(d, ev)
+		i, ok := index[dest]
+		if !ok {
+			i = len(groups)
+			index[dest] = i
+			groups = append(groups, slackDestinationGroup{dest: dest})
+		}
+		groups[i].evs = append(groups[i].evs, ev)
+	}
+	return groups
+}
+
+// destination resolves where a single ref update should be posted:
+// the rule-matched channel/webhook override if one applies, otherwise
+// this notifier's default. The returned route is also the rule (if
+// any), so callers can pick up its message template.
+func (n *slackNotifier) destination(d *data, ev *updateEvent) (dest string, rule *routingRule) {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if ok {
+		rule = matchRule(projectID, repoName, ev.RefName, ev.UpdateType)
+	}
+
+	if n.client == nil {
+		dest = slackURL
+		if rule != nil && rule.WebhookURL != "" {
+			dest = rule.WebhookURL
+		}
+		return dest, rule
+	}
+
+	dest = n.channel
+	if rule != nil && rule.Channel != "" {
+		dest = rule.Channel
+	}
+	return dest, rule
+}
+
+// notifyViaWebhook posts through the incoming webhook. slack-go
+// v0.6.2's WebhookMessage predates Block Kit support, so this path
+// renders the legacy Attachment format instead of the Block Kit
+// blocks the bot-token path uses.
+func (n *slackNotifier) notifyViaWebhook(ctx context.Context, d *data, group slackDestinationGroup) error {
+	for _, ev := range group.evs {
+		_, rule := n.destination(d, ev)
+		att, err := slackUpdateAttachment(ctx, d, ev, rule)
+		if err != nil {
+			return err
+		}
+		msg := &slack.WebhookMessage{Attachments: []slack.Attachment{att}}
+		err = slack.PostWebhookCustomHTTP(group.dest, &client, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *slackNotifier) notifyViaBot(ctx context.Context, d *data, group slackDestinationGroup) error {
+	evs := group.evs
+	if len(evs) == 1 {
+		_, rule := n.destination(d, evs[0])
+		blocks, err := slackUpdateBlocks(ctx, d, evs[0], rule)
+		if err != nil {
+			return err
+		}
+		_, _, err = n.client.PostMessageContext(ctx, group.dest, slack.MsgOptionBlocks(blocks...))
+		return err
+	}
+
+	_, parentTS, err := n.client.PostMessageContext(ctx, group.dest,
+		slack.MsgOptionBlocks(slackParentBlocks(d, evs)...),
+	)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, ev := range evs {
+		_, rule := n.destination(d, ev)
+		blocks, err := slackUpdateBlocks(ctx, d, ev, rule)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		_, _, err = n.client.PostMessageContext(ctx, group.dest,
+			slack.MsgOptionBlocks(blocks...),
+			slack.MsgOptionTS(parentTS),
+		)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func slackParentBlocks(d *data, evs []*updateEvent) []slack.Block {
+	return []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType,
+				fmt.Sprintf("*%s* received %d ref update(s)", d.Name, len(evs)), false, false),
+			nil, nil,
+		),
+		slack.NewContextBlock("",
+			slack.NewTextBlockObject(slack.MarkdownType, "pushed by "+d.RefUpdateEvent.Email, false, false),
+		),
+	}
+}
+
+// maxSlackBodyLen truncates a commit body before it's put in a message,
+// so a large commit message doesn't blow past Slack's block text limit.
+const maxSlackBodyLen = 300
+
+func slackUpdateBlocks(ctx context.Context, d *data, ev *updateEvent, rule *routingRule) ([]slack.Block, error) {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if !ok {
+		text := fmt.Sprintf("*Repository:* %s\n*Branch:* %s\n*Update type:* %s\n*Commit:* `%s`",
+			d.Name, ev.RefName, ev.UpdateType, ev.NewID)
+		return []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		}, nil
+	}
+
+	ci, err := resolveCommit(ctx, projectID, repoName, ev.NewID)
+	if err != nil {
+		return nil, fmt.Errorf("slack: resolve commit %s: %w", ev.NewID, err)
+	}
+
+	if rule != nil && rule.Template != "" {
+		return renderRuleTemplateBlocks(rule.Template, d, ev, projectID, repoName, ci)
+	}
+
+	text := fmt.Sprintf("*%s*\n*Repository:* %s\n*Branch:* %s\n*Update type:* %s\n*Author:* %s",
+		ci.Subject, d.Name, ev.RefName, ev.UpdateType, ci.Author)
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+
+	if body := truncate(ci.Body, maxSlackBodyLen); body != "" {
+		blocks = append(blocks,
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, body, false, false), nil, nil))
+	}
+
+	contextElems := []slack.MixedElement{
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("Files changed: %d", len(ci.Files)), false, false),
+	}
+	if !ci.Time.IsZero() {
+		contextElems = append(contextElems,
+			slack.NewTextBlockObject(slack.MarkdownType, ci.Time.Format(time.RFC1123), false, false))
+	}
+	blocks = append(blocks, slack.NewContextBlock("", contextElems...))
+
+	if ev.UpdateType == "UPDATE_NON_FAST_FORWARD" {
+		dropped, err := resolveCommitRange(ctx, projectID, repoName, ev.NewID, ev.OldID)
+		if err != nil {
+			return nil, fmt.Errorf("slack: resolve dropped commits: %w", err)
+		}
+		if len(dropped) > 0 {
+			var b strings.Builder
+			b.WriteString("*Dropped commits:*\n")
+			for _, c := range dropped {
+				fmt.Fprintf(&b, "• `%s` %s\n", shortSHA(c.SHA), c.Subject)
+			}
+			blocks = append(blocks,
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, b.String(), false, false), nil, nil))
+		}
+	}
+
+	btn := slack.NewButtonBlockElement("view_diff", ev.NewID,
+		slack.NewTextBlockObject(slack.PlainTextType, "View diff", false, false))
+	btn.URL = commitURL(projectID, repoName, ev.NewID)
+	blocks = append(blocks, slack.NewActionBlock("", btn))
+
+	return blocks, nil
+}
+
+// ruleTemplateData is what a routing rule's text/template is executed
+// with, exposing every commit field a rule might want to reference.
+type ruleTemplateData struct {
+	ProjectID   string
+	Repo        string
+	Ref         string
+	UpdateType  string
+	NewSHA      string
+	OldSHA      string
+	Email       string
+	Subject     string
+	Body        string
+	Author      string
+	AuthorEmail string
+	Files       []string
+	CommitTime  time.Time
+	CommitURL   string
+}
+
+func renderRuleTemplateBlocks(tmpl string, d *data, ev *updateEvent, projectID, repoName string, ci commitInfo) ([]slack.Block, error) {
+	text, err := renderRuleTemplateText(tmpl, d, ev, projectID, repoName, ci)
+	if err != nil {
+		return nil, err
+	}
+
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}, nil
+}
+
+// renderRuleTemplateText executes a routing rule's message template
+// against a single ref update, for notifiers that render plain text
+// rather than Block Kit blocks.
+func renderRuleTemplateText(tmpl string, d *data, ev *updateEvent, projectID, repoName string, ci commitInfo) (string, error) {
+	t, err := template.New("rule").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("slack: parse rule template: %w", err)
+	}
+
+	td := ruleTemplateData{
+		ProjectID:   projectID,
+		Repo:        repoName,
+		Ref:         ev.RefName,
+		UpdateType:  ev.UpdateType,
+		NewSHA:      ev.NewID,
+		OldSHA:      ev.OldID,
+		Email:       d.RefUpdateEvent.Email,
+		Subject:     ci.Subject,
+		Body:        ci.Body,
+		Author:      ci.Author,
+		AuthorEmail: ci.Email,
+		Files:       ci.Files,
+		CommitTime:  ci.Time,
+		CommitURL:   commitURL(projectID, repoName, ev.NewID),
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, td)
+	if err != nil {
+		return "", fmt.Errorf("slack: execute rule template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Back up to a rune boundary so we don't split a multi-byte UTF-8
+	// character in half.
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// slackUpdateAttachment builds the legacy Attachment representation of
+// a ref update, for the webhook path (slack-go v0.6.2's WebhookMessage
+// has no Block Kit support).
+func slackUpdateAttachment(ctx context.Context, d *data, ev *updateEvent, rule *routingRule) (slack.Attachment, error) {
+	projectID, repoName, ok := repoProjectAndName(d.Name)
+	if !ok {
+		text := fmt.Sprintf("*Repository:* %s\n*Branch:* %s\n*Update type:* %s\n*Commit:* `%s`",
+			d.Name, ev.RefName, ev.UpdateType, ev.NewID)
+		return slack.Attachment{
+			Fallback: text,
+			Color:    updateTypeColor[ev.UpdateType],
+			Text:     text,
+		}, nil
+	}
+
+	ci, err := resolveCommit(ctx, projectID, repoName, ev.NewID)
+	if err != nil {
+		return slack.Attachment{}, fmt.Errorf("slack: resolve commit %s: %w", ev.NewID, err)
+	}
+
+	if rule != nil && rule.Template != "" {
+		text, err := renderRuleTemplateText(rule.Template, d, ev, projectID, repoName, ci)
+		if err != nil {
+			return slack.Attachment{}, err
+		}
+		return slack.Attachment{
+			Fallback: text,
+			Color:    updateTypeColor[ev.UpdateType],
+			Text:     text,
+		}, nil
+	}
+
+	text := truncate(ci.Body, maxSlackBodyLen)
+
+	if ev.UpdateType == "UPDATE_NON_FAST_FORWARD" {
+		dropped, err := resolveCommitRange(ctx, projectID, repoName, ev.NewID, ev.OldID)
+		if err != nil {
+			return slack.Attachment{}, fmt.Errorf("slack: resolve dropped commits: %w", err)
+		}
+		if len(dropped) > 0 {
+			var b strings.Builder
+			b.WriteString(text)
+			b.WriteString("\n*Dropped commits:*\n")
+			for _, c := range dropped {
+				fmt.Fprintf(&b, "• `%s` %s\n", shortSHA(c.SHA), c.Subject)
+			}
+			text = b.String()
+		}
+	}
+
+	att := slack.Attachment{
+		Fallback:   ci.Subject,
+		Color:      updateTypeColor[ev.UpdateType],
+		AuthorName: ci.Author,
+		Title:      "View diff",
+		TitleLink:  commitURL(projectID, repoName, ev.NewID),
+		Pretext:    ci.Subject,
+		Text:       text,
+		Fields: []slack.AttachmentField{
+			{Title: "Branch", Value: ev.RefName, Short: true},
+			{Title: "Update Type", Value: ev.UpdateType, Short: true},
+			{Title: "Files changed", Value: strconv.Itoa(len(ci.Files)), Short: true},
+		},
+	}
+	if !ci.Time.IsZero() {
+		att.Ts = json.Number(strconv.FormatInt(ci.Time.Unix(), 10))
+	}
+
+	return att, nil
+}
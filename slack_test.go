@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"under limit", "hello", 10, "hello"},
+		{"exact limit", "hello", 5, "hello"},
+		{"ascii truncation", "hello world", 5, "hello…"},
+		{"splits mid multi-byte rune", "héllo", 2, "h…"},
+		{"lands on rune boundary", "héllo", 3, "hé…"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := truncate(c.s, c.n)
+			if got != c.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", c.s, c.n, got, c.want)
+			}
+		})
+	}
+}